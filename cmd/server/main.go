@@ -43,7 +43,12 @@ func main() {
 
 	log.Printf("Successfully connected to database at %s", cfg.Database.Host)
 
-	ws := service.NewWalletService(db, cfg)
+	ws, err := service.NewWalletService(db, cfg, nil)
+	if err != nil {
+		log.Fatalf("Failed to initialize wallet service: %v", err)
+	}
+	ws.StartIdempotencyGC(context.Background())
+
 	r := mux.NewRouter()
 
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +60,12 @@ func main() {
 	r.HandleFunc("/account/{id}/balance", ws.GetBalance).Methods("GET")
 	r.HandleFunc("/account/{id}/transactions", ws.GetTransactionHistory).Methods("GET")
 	r.HandleFunc("/transfer", ws.Transfer).Methods("POST")
+	r.HandleFunc("/transfer/authorize", ws.AuthorizeTransfer).Methods("POST")
+	r.HandleFunc("/transfer/{id}/capture", ws.CaptureTransfer).Methods("POST")
+	r.HandleFunc("/transfer/{id}/void", ws.VoidTransfer).Methods("POST")
+	r.HandleFunc("/transfer/{id}/reverse", ws.ReverseTransfer).Methods("POST")
+	r.HandleFunc("/transactions", ws.Transactions).Methods("POST")
+	r.HandleFunc("/fx/quote", ws.Quote).Methods("POST")
 
 	r.Use(loggingMiddleware)
 
@@ -34,8 +34,14 @@ type DatabaseConfig struct {
 
 type AppConfig struct {
 	TransactionHistoryLimit int
-	MinTransactionAmount    float64
-	MaxTransactionAmount    float64
+	// MinTransactionAmount and MaxTransactionAmount are exact decimal
+	// strings (e.g. "0.01"), not float64, so they can be parsed directly
+	// into a service.Money without a lossy float round-trip. config can't
+	// import service's Money type itself without an import cycle, since
+	// service already depends on config.
+	MinTransactionAmount string
+	MaxTransactionAmount string
+	IdempotencyKeyTTL    time.Duration
 }
 
 func Load() (*Config, error) {
@@ -47,8 +53,9 @@ func Load() (*Config, error) {
 	maxIdleConn, _ := strconv.Atoi(getEnv("WALLET_DATABASE_MAX_IDLE_CONNECTIONS", "10"))
 
 	historyLimit, _ := strconv.Atoi(getEnv("WALLET_TRANSACTION_HISTORY_LIMIT", "100"))
-	minAmount, _ := strconv.ParseFloat(getEnv("WALLET_MIN_TRANSACTION_AMOUNT", "0.01"), 64)
-	maxAmount, _ := strconv.ParseFloat(getEnv("WALLET_MAX_TRANSACTION_AMOUNT", "1000000"), 64)
+	minAmount := getEnv("WALLET_MIN_TRANSACTION_AMOUNT", "0.01")
+	maxAmount := getEnv("WALLET_MAX_TRANSACTION_AMOUNT", "1000000")
+	idempotencyKeyTTL, _ := time.ParseDuration(getEnv("WALLET_IDEMPOTENCY_KEY_TTL", "24h"))
 
 	return &Config{
 		Server: ServerConfig{
@@ -72,6 +79,7 @@ func Load() (*Config, error) {
 			TransactionHistoryLimit: historyLimit,
 			MinTransactionAmount:    minAmount,
 			MaxTransactionAmount:    maxAmount,
+			IdempotencyKeyTTL:       idempotencyKeyTTL,
 		},
 	}, nil
 }
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeCursor and decodeCursor implement an opaque keyset-pagination
+// cursor over (created_at, id): the pair that ORDER BY t.created_at DESC,
+// t.id DESC is already sorted by, so "give me the page after this cursor"
+// is just a WHERE (created_at, id) < (cursor_created_at, cursor_id).
+
+func encodeCursor(createdAt time.Time, id int64) string {
+	raw := fmt.Sprintf("%d:%d", createdAt.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid cursor")
+	}
+
+	nanosPart, idPart, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid cursor")
+	}
+
+	nanos, err := strconv.ParseInt(nanosPart, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid cursor")
+	}
+
+	return time.Unix(0, nanos), id, nil
+}
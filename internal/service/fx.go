@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const fxQuoteTTL = 30 * time.Second
+
+var (
+	errFXQuoteExpired         = errors.New("fx quote has expired")
+	errFXQuoteMismatch        = errors.New("fx quote does not match this transfer")
+	errFXQuoteAlreadyRedeemed = errors.New("fx quote has already been redeemed")
+	errFXSlippage             = errors.New("executed destination amount is below min_destination_amount")
+)
+
+// FXProvider quotes an exchange rate between two currencies, modeled
+// loosely on Stellar path payments: a quote locks a rate for a short
+// window so a transfer can settle at a known price.
+type FXProvider interface {
+	Rate(ctx context.Context, from, to Currency) (rate float64, asOf time.Time, err error)
+}
+
+// FXQuoteRequest is the input to FXService.Quote.
+type FXQuoteRequest struct {
+	FromCurrency Currency `json:"from_currency" validate:"required,currency"`
+	ToCurrency   Currency `json:"to_currency" validate:"required,currency,nefield=FromCurrency"`
+	Amount       Money    `json:"amount" validate:"moneygt0"`
+}
+
+// FXQuote is a locked exchange rate between two currencies, valid until
+// ExpiresAt.
+type FXQuote struct {
+	ID                string    `json:"id"`
+	FromCurrency      Currency  `json:"from_currency"`
+	ToCurrency        Currency  `json:"to_currency"`
+	SourceAmount      Money     `json:"source_amount"`
+	DestinationAmount Money     `json:"destination_amount"`
+	Rate              float64   `json:"rate"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	CreatedAt         time.Time `json:"created_at,omitempty"`
+}
+
+// FXService quotes and settles cross-currency transfers on top of a
+// pluggable FXProvider.
+type FXService struct {
+	db       *sql.DB
+	provider FXProvider
+}
+
+func NewFXService(db *sql.DB, provider FXProvider) *FXService {
+	return &FXService{db: db, provider: provider}
+}
+
+// Quote locks a rate from the provider and persists it so a later
+// Transfer can redeem it by id.
+func (fx *FXService) Quote(ctx context.Context, req FXQuoteRequest) (*FXQuote, error) {
+	rate, _, err := fx.provider.Rate(ctx, req.FromCurrency, req.ToCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &FXQuote{
+		ID:                uuid.New().String(),
+		FromCurrency:      req.FromCurrency,
+		ToCurrency:        req.ToCurrency,
+		SourceAmount:      req.Amount,
+		DestinationAmount: req.Amount.MulRate(rate, ScaleForCurrency(req.ToCurrency)),
+		Rate:              rate,
+		ExpiresAt:         time.Now().Add(fxQuoteTTL),
+	}
+
+	err = fx.db.QueryRowContext(ctx, `
+        INSERT INTO fx_quotes
+        (id, from_currency, to_currency, source_amount, destination_amount, rate, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+        RETURNING created_at
+    `, quote.ID, quote.FromCurrency, quote.ToCurrency, quote.SourceAmount,
+		quote.DestinationAmount, quote.Rate, quote.ExpiresAt).Scan(&quote.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+// redeem locks a previously issued quote within tx (so it can't be
+// consumed twice by concurrent transfers), validates it against the
+// transfer it's being applied to, and marks it redeemed so it can't be
+// replayed against a second transfer.
+func (fx *FXService) redeem(ctx context.Context, tx *sql.Tx, id string, from, to Currency, sourceAmount, minDestinationAmount Money) (*FXQuote, error) {
+	var q FXQuote
+	var redeemedAt sql.NullTime
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, from_currency, to_currency, source_amount, destination_amount, rate, expires_at, created_at, redeemed_at
+        FROM fx_quotes
+        WHERE id = $1
+        FOR UPDATE
+    `, id).Scan(&q.ID, &q.FromCurrency, &q.ToCurrency, &q.SourceAmount,
+		&q.DestinationAmount, &q.Rate, &q.ExpiresAt, &q.CreatedAt, &redeemedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if redeemedAt.Valid {
+		return nil, errFXQuoteAlreadyRedeemed
+	}
+	if time.Now().After(q.ExpiresAt) {
+		return nil, errFXQuoteExpired
+	}
+
+	sourceMatches, err := q.SourceAmount.Equal(sourceAmount)
+	if err != nil {
+		return nil, errFXQuoteMismatch
+	}
+	if q.FromCurrency != from || q.ToCurrency != to || !sourceMatches {
+		return nil, errFXQuoteMismatch
+	}
+	if !minDestinationAmount.IsZero() {
+		cmp, err := compareMoney(q.DestinationAmount, minDestinationAmount)
+		if err != nil {
+			return nil, err
+		}
+		if cmp < 0 {
+			return nil, errFXSlippage
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE fx_quotes SET redeemed_at = CURRENT_TIMESTAMP WHERE id = $1
+    `, id); err != nil {
+		return nil, err
+	}
+
+	return &q, nil
+}
+
+// StaticRateFXProvider returns a fixed rate for each currency pair it's
+// configured with. It's meant for tests and local development, where
+// hitting a real rate service isn't desirable.
+type StaticRateFXProvider struct {
+	rates map[Currency]map[Currency]float64
+}
+
+func NewStaticRateFXProvider(rates map[Currency]map[Currency]float64) *StaticRateFXProvider {
+	return &StaticRateFXProvider{rates: rates}
+}
+
+func (p *StaticRateFXProvider) Rate(_ context.Context, from, to Currency) (float64, time.Time, error) {
+	if from == to {
+		return 1, time.Now(), nil
+	}
+	if rate, ok := p.rates[from][to]; ok {
+		return rate, time.Now(), nil
+	}
+	return 0, time.Time{}, fmt.Errorf("no static rate configured for %s -> %s", from, to)
+}
+
+// DefaultFXProvider returns a StaticRateFXProvider seeded with example
+// rates for the currencies this service supports. It's a reasonable
+// out-of-the-box default; production deployments should plug in a real
+// FXProvider instead.
+func DefaultFXProvider() FXProvider {
+	return NewStaticRateFXProvider(map[Currency]map[Currency]float64{
+		USD: {EUR: 0.92, GBP: 0.79, KZT: 450},
+		EUR: {USD: 1.09, GBP: 0.86, KZT: 490},
+		GBP: {USD: 1.27, EUR: 1.16, KZT: 570},
+		KZT: {USD: 0.0022, EUR: 0.0020, GBP: 0.0018},
+	})
+}
+
+// HTTPFXProvider fetches rates from an external FX rate service over
+// HTTP. It's a thin stub: point it at a real provider's base URL and
+// adjust the response shape it expects as needed.
+type HTTPFXProvider struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewHTTPFXProvider(baseURL string) *HTTPFXProvider {
+	return &HTTPFXProvider{BaseURL: baseURL, Client: http.DefaultClient}
+}
+
+func (p *HTTPFXProvider) Rate(ctx context.Context, from, to Currency) (float64, time.Time, error) {
+	url := fmt.Sprintf("%s/rate?from=%s&to=%s", p.BaseURL, from, to)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Time{}, fmt.Errorf("fx provider returned status %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Rate float64   `json:"rate"`
+		AsOf time.Time `json:"as_of"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return payload.Rate, payload.AsOf, nil
+}
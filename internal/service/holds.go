@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	holdStatusPending  = "pending"
+	holdStatusCaptured = "captured"
+	holdStatusVoided   = "voided"
+)
+
+var (
+	errHoldNotPending        = errors.New("hold is not pending")
+	errInsufficientAvailable = errors.New("insufficient available funds")
+	errCaptureExceedsHold    = errors.New("capture amount exceeds the held amount")
+)
+
+// Hold is a two-phase authorize/capture reservation: authorizing a Hold
+// decrements From's available balance without moving anything in the
+// ledger, capturing it settles some or all of the held amount as a real
+// transaction, and voiding it releases the reservation untouched. Holds
+// are tracked in their own table rather than as pending postings, since
+// an uncaptured hold should never show up as a posting in the ledger
+// itself - but recordEntry still subtracts pending holds from the
+// post-entry balance it checks, so an ordinary transfer or batch entry
+// can't spend funds a hold has already reserved.
+type Hold struct {
+	ID        int64     `json:"id,omitempty"`
+	From      string    `json:"from" validate:"required,uuid4"`
+	To        string    `json:"to" validate:"required,uuid4,nefield=From"`
+	Amount    Money     `json:"amount" validate:"moneygt0"`
+	Status    string    `json:"status,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// CaptureRequest optionally captures less than a hold's full amount; the
+// remainder is released back to the source account's available balance.
+// A zero Amount captures the hold in full.
+type CaptureRequest struct {
+	Amount Money `json:"amount,omitempty" validate:"omitempty,moneygt0"`
+}
+
+// BalanceResponse reports both of an account's balances: Ledger is the
+// sum of its settled postings (see getLedgerBalance), while Available
+// additionally subtracts any funds earmarked by a pending Hold.
+type BalanceResponse struct {
+	ID        string    `json:"id"`
+	Currency  Currency  `json:"currency"`
+	Available Money     `json:"available"`
+	Ledger    Money     `json:"ledger"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// heldBalance returns the sum of an account's pending holds, i.e. the
+// portion of its ledger balance that's earmarked but not yet settled. It
+// reads via q so a caller already holding the account locked inside a
+// transaction (e.g. recordEntry) sees a consistent snapshot instead of
+// racing a separate connection against a concurrent hold authorization.
+// excludeHoldID omits one hold's own amount from the sum - used by
+// recordEntry while settling that hold, which is still "pending" at the
+// point of the check; pass 0 to exclude nothing.
+func (ws *WalletService) heldBalance(ctx context.Context, q queryer, accountID string, excludeHoldID int64) (Money, error) {
+	var held Money
+	err := q.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(amount), 0) FROM holds WHERE from_account_id = $1 AND status = $2 AND id <> $3
+    `, accountID, holdStatusPending, excludeHoldID).Scan(&held)
+	return held, err
+}
+
+// availableBalance is an account's ledger balance less its held balance:
+// the funds it could still authorize or transfer right now.
+func (ws *WalletService) availableBalance(ctx context.Context, q queryer, accountID string) (Money, error) {
+	ledger, err := ws.getLedgerBalance(ctx, q, accountID)
+	if err != nil {
+		return Money{}, err
+	}
+	held, err := ws.heldBalance(ctx, q, accountID, 0)
+	if err != nil {
+		return Money{}, err
+	}
+	// Both sums come back at the database's own scale, which differs
+	// between an empty sum ("0") and a non-empty one; bring them to the
+	// finer of the two before subtracting.
+	scale := ledger.Scale
+	if held.Scale > scale {
+		scale = held.Scale
+	}
+	if ledger, err = ledger.Rescale(scale); err != nil {
+		return Money{}, err
+	}
+	if held, err = held.Rescale(scale); err != nil {
+		return Money{}, err
+	}
+	return ledger.Sub(held)
+}
+
+// authorizeHold locks From the same way recordEntry locks accounts, so
+// concurrent authorizations against it serialize, then checks its
+// available balance (ledger balance less any other pending holds) covers
+// amount before recording a pending hold.
+func (ws *WalletService) authorizeHold(ctx context.Context, tx *sql.Tx, from, to string, amount Money) (*Hold, error) {
+	var currency Currency
+	if err := tx.QueryRowContext(ctx, `
+        SELECT currency FROM accounts WHERE id = $1 FOR UPDATE
+    `, from).Scan(&currency); err != nil {
+		return nil, err
+	}
+
+	var toExists bool
+	if err := tx.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)
+    `, to).Scan(&toExists); err != nil {
+		return nil, err
+	}
+	if !toExists {
+		return nil, sql.ErrNoRows
+	}
+
+	rescaledAmount, err := amount.Rescale(ScaleForCurrency(currency))
+	if err != nil {
+		return nil, errInvalidAmountScale
+	}
+
+	available, err := ws.availableBalance(ctx, tx, from)
+	if err != nil {
+		return nil, err
+	}
+	available, err = available.Rescale(ScaleForCurrency(currency))
+	if err != nil {
+		return nil, err
+	}
+
+	newAvailable, err := available.Sub(rescaledAmount)
+	if err != nil {
+		return nil, err
+	}
+	if newAvailable.IsNegative() {
+		return nil, errInsufficientAvailable
+	}
+
+	hold := &Hold{From: from, To: to, Amount: rescaledAmount, Status: holdStatusPending}
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO holds (from_account_id, to_account_id, amount, status, created_at)
+        VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+        RETURNING id, created_at
+    `, hold.From, hold.To, hold.Amount, hold.Status).Scan(&hold.ID, &hold.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// resolveCaptureAmount determines how much of hold to settle: the hold's
+// full amount if amount is nil, otherwise amount rescaled to the hold's own
+// scale. It rejects a capture amount greater than what's actually held.
+func resolveCaptureAmount(hold Hold, amount *Money) (Money, error) {
+	if amount == nil {
+		return hold.Amount, nil
+	}
+	rescaled, err := amount.Rescale(hold.Amount.Scale)
+	if err != nil {
+		return Money{}, errInvalidAmountScale
+	}
+	if rescaled.Units > hold.Amount.Units {
+		return Money{}, errCaptureExceedsHold
+	}
+	return rescaled, nil
+}
+
+// captureHold locks a pending hold, settles up to its full amount as a
+// real ledger transaction via recordEntry, and marks it captured. A nil
+// amount captures the hold in full; otherwise the remainder is simply
+// left uncaptured, which (the hold now being non-pending) releases it
+// back into From's available balance.
+func (ws *WalletService) captureHold(ctx context.Context, tx *sql.Tx, holdID int64, amount *Money) (*Entry, error) {
+	var hold Hold
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, from_account_id, to_account_id, amount, status, created_at
+        FROM holds
+        WHERE id = $1
+        FOR UPDATE
+    `, holdID).Scan(&hold.ID, &hold.From, &hold.To, &hold.Amount, &hold.Status, &hold.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != holdStatusPending {
+		return nil, errHoldNotPending
+	}
+
+	captureAmount, err := resolveCaptureAmount(hold, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	postings := []PostingEntry{
+		{AccountID: hold.From, Amount: captureAmount.Negate()},
+		{AccountID: hold.To, Amount: captureAmount},
+	}
+
+	transactionID, createdAt, err := ws.recordEntry(ctx, tx, postings, "", "", nil, 0, nil, hold.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE holds SET status = $1, transaction_id = $2 WHERE id = $3
+    `, holdStatusCaptured, transactionID, hold.ID); err != nil {
+		return nil, err
+	}
+
+	return &Entry{ID: transactionID, Postings: postings, Status: transactionStatusCompleted, CreatedAt: createdAt}, nil
+}
+
+// voidHold locks a pending hold and releases it without moving any
+// funds.
+func (ws *WalletService) voidHold(ctx context.Context, tx *sql.Tx, holdID int64) (*Hold, error) {
+	var hold Hold
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, from_account_id, to_account_id, amount, status, created_at
+        FROM holds
+        WHERE id = $1
+        FOR UPDATE
+    `, holdID).Scan(&hold.ID, &hold.From, &hold.To, &hold.Amount, &hold.Status, &hold.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != holdStatusPending {
+		return nil, errHoldNotPending
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE holds SET status = $1 WHERE id = $2
+    `, holdStatusVoided, hold.ID); err != nil {
+		return nil, err
+	}
+
+	hold.Status = holdStatusVoided
+	return &hold, nil
+}
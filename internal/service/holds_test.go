@@ -0,0 +1,41 @@
+package service
+
+import "testing"
+
+func TestResolveCaptureAmount(t *testing.T) {
+	hold := Hold{Amount: mustMoney(t, USD, "100.00")}
+
+	cases := []struct {
+		name    string
+		amount  *Money
+		want    string
+		wantErr error
+	}{
+		{name: "nil captures in full", amount: nil, want: "100.00"},
+		{name: "partial capture", amount: moneyPtr(mustMoney(t, USD, "40.00")), want: "40.00"},
+		{name: "full capture via explicit amount", amount: moneyPtr(mustMoney(t, USD, "100.00")), want: "100.00"},
+		{name: "exceeds hold", amount: moneyPtr(mustMoney(t, USD, "100.01")), wantErr: errCaptureExceedsHold},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveCaptureAmount(hold, tc.amount)
+			if tc.wantErr != nil {
+				if err != tc.wantErr {
+					t.Fatalf("resolveCaptureAmount: got err %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveCaptureAmount: %v", err)
+			}
+			if got.String() != tc.want {
+				t.Fatalf("resolveCaptureAmount = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func moneyPtr(m Money) *Money {
+	return &m
+}
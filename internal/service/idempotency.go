@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyEndpointCreateAccount = "POST /account"
+	idempotencyEndpointTransfer      = "POST /transfer"
+	idempotencyEndpointTransactions  = "POST /transactions"
+	idempotencyEndpointAuthorize     = "POST /transfer/authorize"
+	idempotencyEndpointCapture       = "POST /transfer/{id}/capture"
+	idempotencyEndpointReverse       = "POST /transfer/{id}/reverse"
+
+	idempotencySweepInterval = 10 * time.Minute
+)
+
+// ErrIdempotencyKeyMismatch is returned when an Idempotency-Key is reused
+// with a request body that hashes differently than the one it was first
+// claimed with.
+var ErrIdempotencyKeyMismatch = errors.New("idempotency key reused with a different request body")
+
+// CachedResponse is the persisted result of a previously completed request
+// for a given Idempotency-Key.
+type CachedResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// IdempotencyStore lets handlers safely replay the result of a previous
+// POST instead of re-executing it, keyed by the client-supplied
+// Idempotency-Key header. Completed claims are persisted in the
+// idempotency_keys table, keyed by (endpoint, key). Claims still in flight
+// are coalesced in memory so concurrent retries of the same request block
+// on the first one instead of racing it in the database.
+type IdempotencyStore struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]*sync.WaitGroup
+}
+
+func NewIdempotencyStore(db *sql.DB, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		db:       db,
+		ttl:      ttl,
+		inflight: make(map[string]*sync.WaitGroup),
+	}
+}
+
+// HashBody returns a stable hash of a request body, used to detect
+// retries that reuse a key with a different payload.
+func HashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Claim represents exclusive ownership of an (endpoint, key) pair, held by
+// whichever request first claims it. The owner must call Finish to
+// persist the response as part of its own DB transaction, and Release
+// once that transaction has committed or rolled back, so waiting
+// duplicates can proceed.
+type Claim struct {
+	store    *IdempotencyStore
+	endpoint string
+	key      string
+	hash     string
+	wg       *sync.WaitGroup
+}
+
+// inflightKey composes the in-flight coalescing map's key, matching the
+// (endpoint, key) compound key the idempotency_keys table is keyed on: an
+// Idempotency-Key value is only meant to dedupe retries of the same
+// request, so two different endpoints reusing the same header value must
+// not block on each other.
+func inflightKey(endpoint, key string) string {
+	return endpoint + "\x00" + key
+}
+
+// Begin claims (endpoint, key) for the caller. If a request with the same
+// key already completed, its cached response is returned when the body
+// hash matches, or ErrIdempotencyKeyMismatch when it doesn't. If a request
+// with the same key is currently in flight, Begin blocks until it
+// finishes and then resolves as above. Otherwise the caller becomes the
+// claim owner and must call Finish and Release.
+func (s *IdempotencyStore) Begin(ctx context.Context, endpoint, key, bodyHash string) (*CachedResponse, *Claim, error) {
+	inflight := inflightKey(endpoint, key)
+	for {
+		s.mu.Lock()
+		wg, inFlight := s.inflight[inflight]
+		if inFlight {
+			s.mu.Unlock()
+			wg.Wait()
+			continue
+		}
+
+		wg = &sync.WaitGroup{}
+		wg.Add(1)
+		s.inflight[inflight] = wg
+		s.mu.Unlock()
+
+		cached, err := s.lookup(ctx, endpoint, key, bodyHash)
+		if err != nil || cached != nil {
+			s.release(inflight, wg)
+			return cached, nil, err
+		}
+
+		return nil, &Claim{store: s, endpoint: endpoint, key: key, hash: bodyHash, wg: wg}, nil
+	}
+}
+
+func (s *IdempotencyStore) lookup(ctx context.Context, endpoint, key, bodyHash string) (*CachedResponse, error) {
+	var hash string
+	var statusCode int
+	var body []byte
+
+	err := s.db.QueryRowContext(ctx, `
+        SELECT request_hash, status_code, response_body
+        FROM idempotency_keys
+        WHERE endpoint = $1 AND key = $2
+    `, endpoint, key).Scan(&hash, &statusCode, &body)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hash != bodyHash {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+	return &CachedResponse{StatusCode: statusCode, Body: body}, nil
+}
+
+func (s *IdempotencyStore) release(inflight string, wg *sync.WaitGroup) {
+	s.mu.Lock()
+	delete(s.inflight, inflight)
+	s.mu.Unlock()
+	wg.Done()
+}
+
+// Finish persists the claimed response as part of tx, the caller's own DB
+// transaction, so the idempotency record only becomes visible once that
+// transaction commits.
+func (c *Claim) Finish(ctx context.Context, tx *sql.Tx, statusCode int, body []byte) error {
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO idempotency_keys (endpoint, key, request_hash, status_code, response_body, created_at)
+        VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+    `, c.endpoint, c.key, c.hash, statusCode, body)
+	return err
+}
+
+// Release unblocks any requests waiting on this claim. It must be called
+// after the owning transaction has committed or rolled back, whether or
+// not Finish was reached.
+func (c *Claim) Release() {
+	c.store.release(inflightKey(c.endpoint, c.key), c.wg)
+}
+
+// StartSweeper periodically purges idempotency keys older than the
+// store's TTL. It runs until ctx is cancelled.
+func (s *IdempotencyStore) StartSweeper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(idempotencySweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.sweep(ctx); err != nil {
+					log.Printf("Error sweeping idempotency keys: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *IdempotencyStore) sweep(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+        DELETE FROM idempotency_keys WHERE created_at < $1
+    `, time.Now().Add(-s.ttl))
+	return err
+}
@@ -0,0 +1,23 @@
+package service
+
+import "testing"
+
+func TestInflightKeyDistinguishesEndpoints(t *testing.T) {
+	a := inflightKey("POST /transfer", "dup-key")
+	b := inflightKey("POST /account", "dup-key")
+
+	if a == b {
+		t.Fatalf("inflightKey(%q) and inflightKey(%q) collided: %q", "POST /transfer", "POST /account", a)
+	}
+}
+
+func TestHashBodyStable(t *testing.T) {
+	body := []byte(`{"from":"a","to":"b","amount":"10.00"}`)
+
+	if HashBody(body) != HashBody(body) {
+		t.Fatal("HashBody is not stable for identical input")
+	}
+	if HashBody(body) == HashBody([]byte(`{"from":"a","to":"b","amount":"10.01"}`)) {
+		t.Fatal("HashBody produced the same hash for different bodies")
+	}
+}
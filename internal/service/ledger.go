@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// The accounts.balance column has been replaced by an append-only ledger:
+// every transaction writes one posting per leg to the postings table, and
+// an account's balance is the sum of its postings. Migrating an existing
+// deployment means seeding the ledger with one opening posting per account
+// that credits its current balance against a zero-balance "opening
+// balance" equity account, so existing totals are preserved and every
+// future entry composes on top of real, immutable history.
+
+var (
+	errUnbalancedEntry    = errors.New("postings do not sum to zero")
+	errInsufficientFunds  = errors.New("insufficient funds")
+	errInvalidAmountScale = errors.New("posting amount has more precision than its account's currency allows")
+)
+
+const ledgerBalanceQuery = `SELECT COALESCE(SUM(amount), 0) FROM postings WHERE account_id = $1`
+
+const (
+	transactionStatusCompleted = "completed"
+	transactionStatusReversed  = "reversed"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so read-only lookups
+// can run against either a plain connection or an in-flight transaction.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// accountCurrencies looks up the currency of two accounts without locking
+// them, used to decide whether a transfer is cross-currency before the
+// entry is actually recorded.
+func (ws *WalletService) accountCurrencies(ctx context.Context, q queryer, fromID, toID string) (from, to Currency, err error) {
+	if err = q.QueryRowContext(ctx, `SELECT currency FROM accounts WHERE id = $1`, fromID).Scan(&from); err != nil {
+		return "", "", err
+	}
+	if err = q.QueryRowContext(ctx, `SELECT currency FROM accounts WHERE id = $1`, toID).Scan(&to); err != nil {
+		return "", "", err
+	}
+	return from, to, nil
+}
+
+// recordEntry persists a balanced multi-leg accounting entry as one
+// transactions row plus one postings row per leg, all within tx. Every
+// account touched by the entry is locked, in a deterministic order so
+// concurrent entries can't deadlock against each other, and its running
+// balance is re-read under that lock so no account balance goes negative
+// as a result of the entry. Postings are balanced per-currency rather than
+// in aggregate, so a single entry may freely mix postings against
+// accounts of different currencies (as a cross-currency transfer does);
+// see checkBalanced for how fxImbalances relaxes that check for the two
+// currencies a cross-currency transfer's legs touch.
+//
+// An account's pending holds (see holds.go) are subtracted from its
+// post-entry ledger balance the same way availableBalance does, so an
+// ordinary transfer or batch entry can't spend funds a hold has already
+// reserved for a future capture; capturingHoldID excludes the hold this
+// entry itself is settling from that check (it's still "pending" at this
+// point - captureHold only marks it captured after recordEntry succeeds),
+// pass 0 for an entry that isn't capturing a hold.
+//
+// memo and metadata are stored alongside the transaction for later lookup
+// by GetTransactionHistory; metadata is passed through as raw JSON and
+// stored in the transactions.metadata JSONB column. If reference is
+// non-empty and a transaction with that reference already exists (via the
+// partial unique index on transactions.reference), recordEntry returns
+// that transaction's id and created_at unchanged instead of recording a
+// new entry, so retried requests that don't carry an Idempotency-Key
+// still can't double-post; the insert itself uses ON CONFLICT DO NOTHING
+// against that same index so two concurrent requests racing on a new
+// reference can't both win. reversesTransactionID links the entry to the
+// transaction it compensates for (see reverseTransaction); pass 0 for an
+// ordinary entry.
+func (ws *WalletService) recordEntry(ctx context.Context, tx *sql.Tx, postings []PostingEntry, memo, reference string, metadata json.RawMessage, reversesTransactionID int64, fxImbalances map[Currency]Money, capturingHoldID int64) (int64, time.Time, error) {
+	if reference != "" {
+		var existingID int64
+		var existingCreatedAt time.Time
+		err := tx.QueryRowContext(ctx, `
+            SELECT id, created_at FROM transactions WHERE reference = $1
+        `, reference).Scan(&existingID, &existingCreatedAt)
+		if err == nil {
+			return existingID, existingCreatedAt, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, time.Time{}, err
+		}
+	}
+
+	accountIDs := make([]string, 0, len(postings))
+	seen := make(map[string]bool, len(postings))
+	for _, p := range postings {
+		if !seen[p.AccountID] {
+			seen[p.AccountID] = true
+			accountIDs = append(accountIDs, p.AccountID)
+		}
+	}
+	sort.Strings(accountIDs)
+
+	currencies := make(map[string]Currency, len(accountIDs))
+	balances := make(map[string]Money, len(accountIDs))
+	for _, id := range accountIDs {
+		var currency Currency
+		err := tx.QueryRowContext(ctx, `
+            SELECT currency FROM accounts WHERE id = $1 FOR UPDATE
+        `, id).Scan(&currency)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		currencies[id] = currency
+
+		var balance Money
+		if err := tx.QueryRowContext(ctx, ledgerBalanceQuery, id).Scan(&balance); err != nil {
+			return 0, time.Time{}, err
+		}
+		rescaled, err := balance.Rescale(ScaleForCurrency(currency))
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		balances[id] = rescaled
+	}
+
+	// Postings arrive at whatever scale their amount string implied; rescale
+	// each to its account's canonical currency scale before it's summed or
+	// applied, so e.g. "10" and "10.00" against the same USD account net out
+	// identically.
+	for i, p := range postings {
+		rescaled, err := p.Amount.Rescale(ScaleForCurrency(currencies[p.AccountID]))
+		if err != nil {
+			return 0, time.Time{}, errInvalidAmountScale
+		}
+		postings[i].Amount = rescaled
+	}
+
+	if err := checkBalanced(postings, currencies, fxImbalances); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	for _, p := range postings {
+		newBalance, err := balances[p.AccountID].Add(p.Amount)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		balances[p.AccountID] = newBalance
+		if newBalance.IsNegative() {
+			return 0, time.Time{}, errInsufficientFunds
+		}
+	}
+
+	for _, id := range accountIDs {
+		held, err := ws.heldBalance(ctx, tx, id, capturingHoldID)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		held, err = held.Rescale(balances[id].Scale)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		availableAfter, err := balances[id].Sub(held)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if availableAfter.IsNegative() {
+			return 0, time.Time{}, errInsufficientFunds
+		}
+	}
+
+	var metadataArg interface{}
+	if len(metadata) > 0 {
+		metadataArg = string(metadata)
+	}
+
+	// ON CONFLICT targets the partial unique index on transactions.reference
+	// (a NULL reference never conflicts, so this is a no-op for the
+	// common case of an unreferenced entry). If another transaction wins
+	// the race to insert this reference first, this INSERT returns no row
+	// instead of erroring, and the fallback SELECT below returns the
+	// winner's row - closing the race the preliminary lookup above can't,
+	// since that lookup runs before either side has locked anything.
+	var transactionID int64
+	var createdAt time.Time
+	err := tx.QueryRowContext(ctx, `
+        INSERT INTO transactions (status, memo, metadata, reference, reverses_transaction_id, created_at)
+        VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+        ON CONFLICT (reference) WHERE reference IS NOT NULL DO NOTHING
+        RETURNING id, created_at
+    `, transactionStatusCompleted, sql.NullString{String: memo, Valid: memo != ""}, metadataArg,
+		sql.NullString{String: reference, Valid: reference != ""},
+		sql.NullInt64{Int64: reversesTransactionID, Valid: reversesTransactionID != 0}).Scan(&transactionID, &createdAt)
+	if err == sql.ErrNoRows && reference != "" {
+		err = tx.QueryRowContext(ctx, `
+            SELECT id, created_at FROM transactions WHERE reference = $1
+        `, reference).Scan(&transactionID, &createdAt)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return transactionID, createdAt, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	for _, p := range postings {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO postings (transaction_id, account_id, amount, created_at)
+            VALUES ($1, $2, $3, $4)
+        `, transactionID, p.AccountID, p.Amount, createdAt)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+	}
+
+	return transactionID, createdAt, nil
+}
+
+// checkBalanced verifies that postings sum to zero for every currency they
+// touch, except for a currency named in fxImbalances, whose postings must
+// instead sum to exactly the given amount. Plain transfers and
+// TransactionBatch entries pass a nil fxImbalances, enforcing the usual
+// zero-sum invariant everywhere; a cross-currency transfer passes the
+// debited and credited amounts its already-redeemed FX quote committed it
+// to, which is what lets a posting that debits one currency and credits a
+// different one (with nothing booked against either currency's opposite
+// leg) pass as balanced.
+func checkBalanced(postings []PostingEntry, currencies map[string]Currency, fxImbalances map[Currency]Money) error {
+	sums := make(map[Currency]Money, len(currencies))
+	for _, currency := range currencies {
+		if _, ok := sums[currency]; !ok {
+			sums[currency] = ZeroMoney(currency)
+		}
+	}
+	for _, p := range postings {
+		currency := currencies[p.AccountID]
+		sum, err := sums[currency].Add(p.Amount)
+		if err != nil {
+			return err
+		}
+		sums[currency] = sum
+	}
+
+	for currency, sum := range sums {
+		expected := ZeroMoney(currency)
+		if imbalance, ok := fxImbalances[currency]; ok {
+			rescaled, err := imbalance.Rescale(sum.Scale)
+			if err != nil {
+				return err
+			}
+			expected = rescaled
+		}
+
+		diff, err := sum.Sub(expected)
+		if err != nil {
+			return err
+		}
+		if !diff.IsZero() {
+			return errUnbalancedEntry
+		}
+	}
+	return nil
+}
+
+// getLedgerBalance returns an account's balance as the sum of its
+// postings, read via q so a caller already inside a transaction (e.g.
+// authorizeHold via availableBalance, which holds the account locked)
+// reads within that transaction instead of racing a separate connection.
+// The result is at whatever scale the database returns it in, not
+// rescaled to the account's currency scale.
+func (ws *WalletService) getLedgerBalance(ctx context.Context, q queryer, accountID string) (Money, error) {
+	var balance Money
+	err := q.QueryRowContext(ctx, ledgerBalanceQuery, accountID).Scan(&balance)
+	return balance, err
+}
+
+// Entry is the response shape for a committed TransactionBatch.
+type Entry struct {
+	ID        int64           `json:"id"`
+	Postings  []PostingEntry  `json:"postings"`
+	Status    string          `json:"status"`
+	Memo      string          `json:"memo,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	Reference string          `json:"reference,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// LedgerEntry is one posting against an account, as returned by
+// GetTransactionHistory: the posting's own amount plus the status, memo,
+// metadata, and reference of the transaction it belongs to.
+type LedgerEntry struct {
+	TransactionID int64           `json:"transaction_id"`
+	AccountID     string          `json:"account_id"`
+	Amount        Money           `json:"amount"`
+	Status        string          `json:"status"`
+	Memo          string          `json:"memo,omitempty"`
+	Metadata      json.RawMessage `json:"metadata,omitempty"`
+	Reference     string          `json:"reference,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
@@ -0,0 +1,94 @@
+package service
+
+import "testing"
+
+func mustMoney(t *testing.T, currency Currency, decimal string) Money {
+	t.Helper()
+	m, err := NewMoney(currency, decimal)
+	if err != nil {
+		t.Fatalf("NewMoney(%s, %q): %v", currency, decimal, err)
+	}
+	return m
+}
+
+func TestCheckBalancedSameCurrencyTransfer(t *testing.T) {
+	postings := []PostingEntry{
+		{AccountID: "from", Amount: mustMoney(t, USD, "-100.00")},
+		{AccountID: "to", Amount: mustMoney(t, USD, "100.00")},
+	}
+	currencies := map[string]Currency{"from": USD, "to": USD}
+
+	if err := checkBalanced(postings, currencies, nil); err != nil {
+		t.Fatalf("expected a same-currency transfer to balance, got: %v", err)
+	}
+}
+
+func TestCheckBalancedSameCurrencyRejectsMismatch(t *testing.T) {
+	postings := []PostingEntry{
+		{AccountID: "from", Amount: mustMoney(t, USD, "-100.00")},
+		{AccountID: "to", Amount: mustMoney(t, USD, "99.00")},
+	}
+	currencies := map[string]Currency{"from": USD, "to": USD}
+
+	if err := checkBalanced(postings, currencies, nil); err != errUnbalancedEntry {
+		t.Fatalf("expected errUnbalancedEntry, got: %v", err)
+	}
+}
+
+// TestCheckBalancedCrossCurrencyTransfer reproduces the chunk0-3 bug: a
+// cross-currency transfer posts one leg per currency with nothing
+// offsetting either side, so without fxImbalances every currency it
+// touches looks unbalanced and the transfer can never succeed.
+func TestCheckBalancedCrossCurrencyTransfer(t *testing.T) {
+	debit := mustMoney(t, USD, "-100.00")
+	credit := mustMoney(t, EUR, "92.00")
+	postings := []PostingEntry{
+		{AccountID: "from", Amount: debit},
+		{AccountID: "to", Amount: credit},
+	}
+	currencies := map[string]Currency{"from": USD, "to": EUR}
+
+	if err := checkBalanced(postings, currencies, nil); err != errUnbalancedEntry {
+		t.Fatalf("expected a cross-currency entry with no fxImbalances to be rejected, got: %v", err)
+	}
+
+	fxImbalances := map[Currency]Money{
+		USD: debit,
+		EUR: credit,
+	}
+	if err := checkBalanced(postings, currencies, fxImbalances); err != nil {
+		t.Fatalf("expected the entry to balance against its declared fxImbalances, got: %v", err)
+	}
+}
+
+func TestCheckBalancedRejectsWrongFXImbalance(t *testing.T) {
+	postings := []PostingEntry{
+		{AccountID: "from", Amount: mustMoney(t, USD, "-100.00")},
+		{AccountID: "to", Amount: mustMoney(t, EUR, "92.00")},
+	}
+	currencies := map[string]Currency{"from": USD, "to": EUR}
+
+	fxImbalances := map[Currency]Money{
+		USD: mustMoney(t, USD, "-100.00"),
+		EUR: mustMoney(t, EUR, "91.00"),
+	}
+	if err := checkBalanced(postings, currencies, fxImbalances); err != errUnbalancedEntry {
+		t.Fatalf("expected postings not matching the declared fxImbalances to be rejected, got: %v", err)
+	}
+}
+
+func TestMoneyEqualIgnoresScale(t *testing.T) {
+	a := mustMoney(t, USD, "100.00")
+	b, err := ParseMoney("100")
+	if err != nil {
+		t.Fatalf("ParseMoney: %v", err)
+	}
+
+	equal, err := a.Equal(b)
+	if err != nil {
+		t.Fatalf("Equal: %v", err)
+	}
+	if !equal {
+		t.Fatalf("expected %q and %q to be equal", a, b)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -27,7 +28,7 @@ func (c Currency) IsValid() bool {
 
 type Account struct {
 	ID        string    `json:"id,omitempty" validate:"omitempty,uuid4"`
-	Balance   float64   `json:"balance,omitempty" validate:"omitempty,min=0"`
+	Balance   Money     `json:"balance,omitempty"`
 	Currency  Currency  `json:"currency" validate:"required,currency"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
 }
@@ -36,9 +37,51 @@ type Transaction struct {
 	ID        int64     `json:"id,omitempty"`
 	From      string    `json:"from" validate:"required,uuid4"`
 	To        string    `json:"to" validate:"required,uuid4,nefield=From"`
-	Amount    float64   `json:"amount" validate:"required,gt=0"`
+	Amount    Money     `json:"amount" validate:"moneygt0,moneymin,moneymax"`
 	Status    string    `json:"status,omitempty"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	// QuoteID redeems a locked FX quote for a cross-currency transfer.
+	// Required when From and To accounts hold different currencies.
+	QuoteID string `json:"quote_id,omitempty" validate:"omitempty,uuid4"`
+	// MinDestinationAmount is a slippage guard: the transfer is rejected
+	// if the quoted destination amount would fall below it.
+	MinDestinationAmount Money `json:"min_destination_amount,omitempty" validate:"omitempty,moneygt0"`
+	// DestinationAmount and Rate are populated on the response of a
+	// cross-currency transfer to report the amount actually credited
+	// and the rate applied.
+	DestinationAmount Money   `json:"destination_amount,omitempty"`
+	Rate              float64 `json:"rate,omitempty"`
+
+	// Memo is a short free-text note attached to the transaction.
+	Memo string `json:"memo,omitempty" validate:"omitempty,max=64"`
+	// Metadata is arbitrary caller-supplied JSON (order id, invoice
+	// number, etc.) stored alongside the transaction for later lookup.
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	// Reference is a client-supplied idempotency key for the transaction
+	// itself: resubmitting the same reference returns the transaction it
+	// was first recorded under instead of creating a new one.
+	Reference string `json:"reference,omitempty" validate:"omitempty,max=255"`
+}
+
+// PostingEntry is one leg of a TransactionBatch: a debit (negative amount)
+// or credit (positive amount) against a single account.
+type PostingEntry struct {
+	AccountID string `json:"account_id" validate:"required,uuid4"`
+	Amount    Money  `json:"amount" validate:"moneynonzero"`
+}
+
+// TransactionBatch is a single balanced accounting entry made up of two or
+// more postings, so multi-leg operations such as fees, splits, or escrow
+// can be recorded as one atomic write instead of a plain from/to transfer.
+type TransactionBatch struct {
+	Postings []PostingEntry `json:"postings" validate:"required,min=2,dive"`
+
+	// Memo, Metadata, and Reference describe the entry as a whole, the
+	// same way they do on Transaction; see the field docs there.
+	Memo      string          `json:"memo,omitempty" validate:"omitempty,max=64"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	Reference string          `json:"reference,omitempty" validate:"omitempty,max=255"`
 }
 
 type ValidationError struct {
@@ -49,11 +92,21 @@ type ValidationError struct {
 
 type Validator struct {
 	validator *validator.Validate
+
+	// minAmount and maxAmount bound a Transaction's Amount; see the
+	// moneymin/moneymax tags registered in RegisterCustomValidations and
+	// config.AppConfig.MinTransactionAmount/MaxTransactionAmount.
+	minAmount Money
+	maxAmount Money
 }
 
-func NewValidator() *Validator {
+// NewValidator builds a Validator whose moneymin/moneymax checks enforce
+// the given amount bounds.
+func NewValidator(minAmount, maxAmount Money) *Validator {
 	v := &Validator{
 		validator: validator.New(),
+		minAmount: minAmount,
+		maxAmount: maxAmount,
 	}
 	v.RegisterCustomValidations()
 	return v
@@ -119,9 +172,133 @@ func (v *Validator) ValidateTransaction(tx *Transaction) []ValidationError {
 	return errors
 }
 
+func (v *Validator) ValidateTransactionBatch(b *TransactionBatch) []ValidationError {
+	var errors []ValidationError
+
+	err := v.validator.Struct(b)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			valErr := ValidationError{
+				Field:   err.Field(),
+				Message: getErrorMsg(err),
+			}
+
+			// Безопасное добавление значения
+			switch value := err.Value().(type) {
+			case string:
+				valErr.Value = value
+			case float64:
+				valErr.Value = value
+			case int:
+				valErr.Value = value
+			default:
+				valErr.Value = fmt.Sprintf("%v", value)
+			}
+
+			errors = append(errors, valErr)
+		}
+	}
+
+	return errors
+}
+
+func (v *Validator) ValidateFXQuoteRequest(req *FXQuoteRequest) []ValidationError {
+	var errors []ValidationError
+
+	err := v.validator.Struct(req)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			valErr := ValidationError{
+				Field:   err.Field(),
+				Message: getErrorMsg(err),
+			}
+
+			// Безопасное добавление значения
+			switch value := err.Value().(type) {
+			case string:
+				valErr.Value = value
+			case float64:
+				valErr.Value = value
+			case int:
+				valErr.Value = value
+			default:
+				valErr.Value = fmt.Sprintf("%v", value)
+			}
+
+			errors = append(errors, valErr)
+		}
+	}
+
+	return errors
+}
+
+func (v *Validator) ValidateHold(h *Hold) []ValidationError {
+	var errors []ValidationError
+
+	err := v.validator.Struct(h)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			valErr := ValidationError{
+				Field:   err.Field(),
+				Message: getErrorMsg(err),
+			}
+
+			// Безопасное добавление значения
+			switch value := err.Value().(type) {
+			case string:
+				valErr.Value = value
+			case float64:
+				valErr.Value = value
+			case int:
+				valErr.Value = value
+			default:
+				valErr.Value = fmt.Sprintf("%v", value)
+			}
+
+			errors = append(errors, valErr)
+		}
+	}
+
+	return errors
+}
+
+func (v *Validator) ValidateCaptureRequest(req *CaptureRequest) []ValidationError {
+	var errors []ValidationError
+
+	err := v.validator.Struct(req)
+	if err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			valErr := ValidationError{
+				Field:   err.Field(),
+				Message: getErrorMsg(err),
+			}
+
+			// Безопасное добавление значения
+			switch value := err.Value().(type) {
+			case string:
+				valErr.Value = value
+			case float64:
+				valErr.Value = value
+			case int:
+				valErr.Value = value
+			default:
+				valErr.Value = fmt.Sprintf("%v", value)
+			}
+
+			errors = append(errors, valErr)
+		}
+	}
+
+	return errors
+}
+
 func (v *Validator) RegisterCustomValidations() {
 	v.validator.RegisterValidation("uuid4", validateUUID4)
 	v.validator.RegisterValidation("currency", validateCurrency)
+	v.validator.RegisterValidation("moneygt0", validateMoneyGT0)
+	v.validator.RegisterValidation("moneynonzero", validateMoneyNonZero)
+	v.validator.RegisterValidation("moneymin", v.validateMoneyMin)
+	v.validator.RegisterValidation("moneymax", v.validateMoneyMax)
 }
 
 func validateCurrency(fl validator.FieldLevel) bool {
@@ -131,6 +308,38 @@ func validateCurrency(fl validator.FieldLevel) bool {
 	return false
 }
 
+func validateMoneyGT0(fl validator.FieldLevel) bool {
+	m, ok := fl.Field().Interface().(Money)
+	return ok && !m.IsNegative() && !m.IsZero()
+}
+
+func validateMoneyNonZero(fl validator.FieldLevel) bool {
+	m, ok := fl.Field().Interface().(Money)
+	return ok && !m.IsZero()
+}
+
+// validateMoneyMin and validateMoneyMax enforce config.AppConfig's
+// MinTransactionAmount/MaxTransactionAmount against a Money field,
+// rescaling to a common scale first so e.g. a "1000000" bound still
+// correctly rejects "1000000.01".
+func (v *Validator) validateMoneyMin(fl validator.FieldLevel) bool {
+	m, ok := fl.Field().Interface().(Money)
+	if !ok {
+		return false
+	}
+	cmp, err := compareMoney(m, v.minAmount)
+	return err == nil && cmp >= 0
+}
+
+func (v *Validator) validateMoneyMax(fl validator.FieldLevel) bool {
+	m, ok := fl.Field().Interface().(Money)
+	if !ok {
+		return false
+	}
+	cmp, err := compareMoney(m, v.maxAmount)
+	return err == nil && cmp <= 0
+}
+
 func validateUUID4(fl validator.FieldLevel) bool {
 	value := fl.Field().String()
 	if value == "" {
@@ -154,6 +363,14 @@ func getErrorMsg(err validator.FieldError) string {
 		return fmt.Sprintf("Field %s cannot be the same as %s", err.Field(), err.Param())
 	case "currency":
 		return fmt.Sprintf("Field %s must be one of: USD, EUR, GBP, KZT", err.Field())
+	case "moneygt0":
+		return fmt.Sprintf("Field %s must be a positive amount", err.Field())
+	case "moneynonzero":
+		return fmt.Sprintf("Field %s must be a nonzero amount", err.Field())
+	case "moneymin":
+		return fmt.Sprintf("Field %s is below the minimum transaction amount", err.Field())
+	case "moneymax":
+		return fmt.Sprintf("Field %s exceeds the maximum transaction amount", err.Field())
 	default:
 		return fmt.Sprintf("Field %s is invalid", err.Field())
 	}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	errMoneyOverflow      = errors.New("money amount overflows int64 minor units")
+	errMoneyScaleMismatch = errors.New("money amounts use different scales")
+)
+
+// currencyScale maps a currency to the number of minor-unit decimal places
+// it's quoted in. All currencies this service supports today are
+// 2-decimal, but the table is what makes adding a 0-decimal (e.g. JPY) or
+// 8-decimal (e.g. a crypto asset) currency later a one-line change.
+var currencyScale = map[Currency]int{
+	USD: 2,
+	EUR: 2,
+	GBP: 2,
+	KZT: 2,
+}
+
+// ScaleForCurrency returns the number of decimal places a currency is
+// quoted in, defaulting to 2 for currencies not in the table.
+func ScaleForCurrency(c Currency) int {
+	if scale, ok := currencyScale[c]; ok {
+		return scale
+	}
+	return 2
+}
+
+// Money is an exact fixed-point amount: Units minor units (e.g. cents),
+// implied to have Scale decimal places. Representing money as integer
+// minor units instead of float64 avoids the rounding drift floats
+// introduce under repeated or concurrent arithmetic.
+type Money struct {
+	Units int64
+	Scale int
+}
+
+// NewMoney parses a decimal string as an amount of currency, normalized to
+// that currency's canonical scale.
+func NewMoney(currency Currency, decimal string) (Money, error) {
+	m, err := ParseMoney(decimal)
+	if err != nil {
+		return Money{}, err
+	}
+	return m.Rescale(ScaleForCurrency(currency))
+}
+
+// ZeroMoney returns a zero amount at currency's canonical scale.
+func ZeroMoney(currency Currency) Money {
+	return Money{Scale: ScaleForCurrency(currency)}
+}
+
+// ParseMoney parses a decimal string into a Money value, inferring its
+// scale from the number of digits given after the decimal point.
+func ParseMoney(decimal string) (Money, error) {
+	var m Money
+	if err := m.parseString(decimal); err != nil {
+		return Money{}, err
+	}
+	return m, nil
+}
+
+func (m *Money) parseString(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return fmt.Errorf("invalid money amount: %q", s)
+	}
+
+	neg := false
+	if s[0] == '-' {
+		neg = true
+		s = s[1:]
+	} else if s[0] == '+' {
+		s = s[1:]
+	}
+
+	wholePart, fracPart, hasFrac := strings.Cut(s, ".")
+	if wholePart == "" {
+		wholePart = "0"
+	}
+
+	whole, err := strconv.ParseInt(wholePart, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid money amount: %q", s)
+	}
+
+	scale := 0
+	var frac int64
+	if hasFrac {
+		scale = len(fracPart)
+		if scale > 0 {
+			frac, err = strconv.ParseInt(fracPart, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid money amount: %q", s)
+			}
+		}
+	}
+
+	units, ok := mulPow10(whole, scale)
+	if !ok {
+		return errMoneyOverflow
+	}
+	units, ok = addInt64(units, frac)
+	if !ok {
+		return errMoneyOverflow
+	}
+	if neg {
+		units = -units
+	}
+
+	m.Units = units
+	m.Scale = scale
+	return nil
+}
+
+// String formats the amount as a plain decimal string, e.g. "12.34".
+func (m Money) String() string {
+	if m.Scale <= 0 {
+		return strconv.FormatInt(m.Units, 10)
+	}
+
+	units := m.Units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	div := pow10(m.Scale)
+	whole := units / div
+	frac := units % div
+	return fmt.Sprintf("%s%d.%0*d", sign, whole, m.Scale, frac)
+}
+
+// Rescale converts m to an equivalent Money at the given scale. Rescaling
+// to a coarser scale fails if doing so would drop nonzero precision.
+func (m Money) Rescale(scale int) (Money, error) {
+	if scale == m.Scale {
+		return m, nil
+	}
+	if scale > m.Scale {
+		units, ok := mulPow10(m.Units, scale-m.Scale)
+		if !ok {
+			return Money{}, errMoneyOverflow
+		}
+		return Money{Units: units, Scale: scale}, nil
+	}
+
+	div := pow10(m.Scale - scale)
+	if m.Units%div != 0 {
+		return Money{}, fmt.Errorf("amount %s has more precision than scale %d allows", m, scale)
+	}
+	return Money{Units: m.Units / div, Scale: scale}, nil
+}
+
+// Add returns m + other. Both must share a scale; use Rescale first if
+// they don't.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Scale != other.Scale {
+		return Money{}, errMoneyScaleMismatch
+	}
+	units, ok := addInt64(m.Units, other.Units)
+	if !ok {
+		return Money{}, errMoneyOverflow
+	}
+	return Money{Units: units, Scale: m.Scale}, nil
+}
+
+// Sub returns m - other. Both must share a scale; use Rescale first if
+// they don't.
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Negate())
+}
+
+// Negate returns -m.
+func (m Money) Negate() Money {
+	return Money{Units: -m.Units, Scale: m.Scale}
+}
+
+// MulRate converts m to another currency's minor units using a floating
+// point exchange rate, rounding to destScale decimal places. Unlike
+// Add/Sub, this isn't exact: FX rates are inherently approximate, so the
+// result is rounded to the destination currency's own precision rather
+// than carried forward at full float precision.
+func (m Money) MulRate(rate float64, destScale int) Money {
+	srcValue := float64(m.Units) / math.Pow10(m.Scale)
+	destUnits := int64(math.Round(srcValue * rate * math.Pow10(destScale)))
+	return Money{Units: destUnits, Scale: destScale}
+}
+
+// IsNegative reports whether m is less than zero.
+func (m Money) IsNegative() bool {
+	return m.Units < 0
+}
+
+// IsZero reports whether m is exactly zero.
+func (m Money) IsZero() bool {
+	return m.Units == 0
+}
+
+// Equal reports whether m and other represent the same amount, rescaling
+// to a common scale first so e.g. "10" and "10.00" compare equal despite
+// differing in Scale.
+func (m Money) Equal(other Money) (bool, error) {
+	cmp, err := compareMoney(m, other)
+	if err != nil {
+		return false, err
+	}
+	return cmp == 0, nil
+}
+
+// compareMoney returns -1, 0, or 1 as a is less than, equal to, or greater
+// than b, rescaling both to whichever of their two scales is finer first
+// so values like "10" and "10.00" compare as equal.
+func compareMoney(a, b Money) (int, error) {
+	scale := a.Scale
+	if b.Scale > scale {
+		scale = b.Scale
+	}
+
+	ra, err := a.Rescale(scale)
+	if err != nil {
+		return 0, err
+	}
+	rb, err := b.Rescale(scale)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case ra.Units < rb.Units:
+		return -1, nil
+	case ra.Units > rb.Units:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// MarshalJSON renders m as a decimal string, e.g. "12.34".
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts either a decimal string ("12.34") or a bare JSON
+// number (12.34), so older clients that haven't migrated to the string
+// encoding keep working during the transition.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return m.parseString(s)
+	}
+
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return fmt.Errorf("invalid money value: %s", data)
+	}
+	return m.parseString(num.String())
+}
+
+// Value implements driver.Valuer so a Money can be passed directly as a
+// query argument.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner so a Money can be scanned directly out of a
+// NUMERIC column.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case string:
+		return m.parseString(v)
+	case []byte:
+		return m.parseString(string(v))
+	case int64:
+		return m.parseString(strconv.FormatInt(v, 10))
+	case float64:
+		return m.parseString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("unsupported Scan source for Money: %T", src)
+	}
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+func mulPow10(v int64, n int) (int64, bool) {
+	result := v
+	for i := 0; i < n; i++ {
+		next := result * 10
+		if result != 0 && next/10 != result {
+			return 0, false
+		}
+		result = next
+	}
+	return result, true
+}
+
+func addInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
@@ -0,0 +1,120 @@
+package service
+
+import "testing"
+
+func TestMoneyAddSub(t *testing.T) {
+	cases := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr bool
+	}{
+		{name: "same scale", a: "10.00", b: "5.50", want: "4.50"},
+		{name: "negative result", a: "5.00", b: "10.00", want: "-5.00"},
+		{name: "scale mismatch", a: "10.00", b: "5", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := ParseMoney(tc.a)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q): %v", tc.a, err)
+			}
+			b, err := ParseMoney(tc.b)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q): %v", tc.b, err)
+			}
+
+			got, err := a.Sub(b)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error subtracting %q from %q", tc.b, tc.a)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sub: %v", err)
+			}
+			if got.String() != tc.want {
+				t.Fatalf("%s - %s = %s, want %s", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompareMoneyIgnoresScale(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want int
+	}{
+		{name: "equal different scale", a: "100", b: "100.00", want: 0},
+		{name: "a less than b", a: "99.99", b: "100.00", want: -1},
+		{name: "a greater than b", a: "100.01", b: "100", want: 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := ParseMoney(tc.a)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q): %v", tc.a, err)
+			}
+			b, err := ParseMoney(tc.b)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q): %v", tc.b, err)
+			}
+
+			got, err := compareMoney(a, b)
+			if err != nil {
+				t.Fatalf("compareMoney: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("compareMoney(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidatorMoneyMinMax(t *testing.T) {
+	minAmount, err := ParseMoney("1.00")
+	if err != nil {
+		t.Fatalf("ParseMoney: %v", err)
+	}
+	maxAmount, err := ParseMoney("1000.00")
+	if err != nil {
+		t.Fatalf("ParseMoney: %v", err)
+	}
+	v := NewValidator(minAmount, maxAmount)
+
+	cases := []struct {
+		name    string
+		amount  string
+		wantErr bool
+	}{
+		{name: "within bounds", amount: "500.00"},
+		{name: "below minimum", amount: "0.50", wantErr: true},
+		{name: "above maximum", amount: "1000.01", wantErr: true},
+		{name: "at minimum", amount: "1.00"},
+		{name: "at maximum", amount: "1000.00"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, err := NewMoney(USD, tc.amount)
+			if err != nil {
+				t.Fatalf("NewMoney: %v", err)
+			}
+			tx := &Transaction{
+				From:   "11111111-1111-4111-8111-111111111111",
+				To:     "22222222-2222-4222-8222-222222222222",
+				Amount: amount,
+			}
+
+			errs := v.ValidateTransaction(tx)
+			hasErr := len(errs) > 0
+			if hasErr != tc.wantErr {
+				t.Fatalf("ValidateTransaction(%s) errors = %v, wantErr %v", tc.amount, errs, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var (
+	errAlreadyReversed = errors.New("transaction has already been reversed")
+	errNotReversible   = errors.New("transaction is not a reversible two-leg transfer")
+)
+
+// reverseTransaction creates a compensating entry for transactionID,
+// crediting every account it debited and debiting every account it
+// credited, linked back to the original via reverses_transaction_id, and
+// marks the original reversed. It refuses to run twice against the same
+// transaction, and refuses anything that isn't a completed, exactly
+// two-leg transfer (a reversed entry, or a TransactionBatch entry with
+// more than two legs, isn't reversible this way).
+func (ws *WalletService) reverseTransaction(ctx context.Context, tx *sql.Tx, transactionID int64) (*Entry, error) {
+	var status string
+	err := tx.QueryRowContext(ctx, `
+        SELECT status FROM transactions WHERE id = $1 FOR UPDATE
+    `, transactionID).Scan(&status)
+	if err != nil {
+		return nil, err
+	}
+	if status == transactionStatusReversed {
+		return nil, errAlreadyReversed
+	}
+	if status != transactionStatusCompleted {
+		return nil, errNotReversible
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT account_id, amount FROM postings WHERE transaction_id = $1
+    `, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var original []PostingEntry
+	for rows.Next() {
+		var p PostingEntry
+		if err := rows.Scan(&p.AccountID, &p.Amount); err != nil {
+			return nil, err
+		}
+		original = append(original, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(original) != 2 {
+		return nil, errNotReversible
+	}
+
+	reversal := make([]PostingEntry, len(original))
+	for i, p := range original {
+		reversal[i] = PostingEntry{AccountID: p.AccountID, Amount: p.Amount.Negate()}
+	}
+
+	fxImbalances, err := reversalFXImbalances(ctx, tx, original)
+	if err != nil {
+		return nil, err
+	}
+
+	entryID, createdAt, err := ws.recordEntry(ctx, tx, reversal, "", "", nil, transactionID, fxImbalances, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE transactions SET status = $1 WHERE id = $2
+    `, transactionStatusReversed, transactionID); err != nil {
+		return nil, err
+	}
+
+	return &Entry{ID: entryID, Postings: reversal, Status: transactionStatusCompleted, CreatedAt: createdAt}, nil
+}
+
+// reversalFXImbalances reconstructs the fxImbalances a reversal needs to
+// pass checkBalanced: for each currency original's own postings summed to
+// a nonzero amount (which only happens for a cross-currency transfer's
+// legs - a same-currency entry's postings always sum to zero already),
+// the reversal's negated postings sum to the negation of that amount, so
+// that's what must be declared as the currency's imbalance. Returns nil
+// for an ordinary same-currency entry, where nothing needs exempting.
+func reversalFXImbalances(ctx context.Context, tx *sql.Tx, original []PostingEntry) (map[Currency]Money, error) {
+	sums := make(map[Currency]Money)
+	for _, p := range original {
+		var currency Currency
+		if err := tx.QueryRowContext(ctx, `
+            SELECT currency FROM accounts WHERE id = $1
+        `, p.AccountID).Scan(&currency); err != nil {
+			return nil, err
+		}
+		sum, ok := sums[currency]
+		if !ok {
+			sum = ZeroMoney(currency)
+		}
+		amount, err := p.Amount.Rescale(ScaleForCurrency(currency))
+		if err != nil {
+			return nil, err
+		}
+		newSum, err := sum.Add(amount)
+		if err != nil {
+			return nil, err
+		}
+		sums[currency] = newSum
+	}
+
+	var fxImbalances map[Currency]Money
+	for currency, sum := range sums {
+		if sum.IsZero() {
+			continue
+		}
+		if fxImbalances == nil {
+			fxImbalances = make(map[Currency]Money)
+		}
+		fxImbalances[currency] = sum.Negate()
+	}
+	return fxImbalances, nil
+}
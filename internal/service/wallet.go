@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 	"wallet/config"
 
@@ -14,25 +18,54 @@ import (
 )
 
 type WalletService struct {
-	db        *sql.DB
-	validator *Validator
-	cfg       *config.Config
+	db          *sql.DB
+	validator   *Validator
+	cfg         *config.Config
+	idempotency *IdempotencyStore
+	fx          *FXService
 }
 
-func NewWalletService(db *sql.DB, cfg *config.Config) *WalletService {
-	validator := NewValidator()
-	validator.RegisterCustomValidations()
+// NewWalletService wires up a WalletService. fxProvider is the pluggable
+// source of exchange rates for cross-currency transfers; pass nil to fall
+// back to DefaultFXProvider.
+func NewWalletService(db *sql.DB, cfg *config.Config, fxProvider FXProvider) (*WalletService, error) {
+	minAmount, err := ParseMoney(cfg.App.MinTransactionAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MinTransactionAmount %q: %w", cfg.App.MinTransactionAmount, err)
+	}
+	maxAmount, err := ParseMoney(cfg.App.MaxTransactionAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxTransactionAmount %q: %w", cfg.App.MaxTransactionAmount, err)
+	}
 
-	return &WalletService{
-		db:        db,
-		validator: validator,
-		cfg:       cfg,
+	if fxProvider == nil {
+		fxProvider = DefaultFXProvider()
 	}
+
+	return &WalletService{
+		db:          db,
+		validator:   NewValidator(minAmount, maxAmount),
+		cfg:         cfg,
+		idempotency: NewIdempotencyStore(db, cfg.App.IdempotencyKeyTTL),
+		fx:          NewFXService(db, fxProvider),
+	}, nil
+}
+
+// StartIdempotencyGC starts the background sweeper that purges expired
+// idempotency keys. It runs until ctx is cancelled.
+func (ws *WalletService) StartIdempotencyGC(ctx context.Context) {
+	ws.idempotency.StartSweeper(ctx)
 }
 
 func (ws *WalletService) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
 	var acc Account
-	if err := json.NewDecoder(r.Body).Decode(&acc); err != nil {
+	if err := json.Unmarshal(body, &acc); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
@@ -42,10 +75,9 @@ func (ws *WalletService) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		acc.ID = GenerateAccountID()
 	}
 
-	// Устанавливаем баланс по умолчанию если не предоставлен
-	if acc.Balance == 0 {
-		acc.Balance = 0
-	}
+	// Новый аккаунт всегда открывается с нулевым балансом: баланс
+	// больше не хранится напрямую, а считается по леджеру постингов
+	acc.Balance = ZeroMoney(acc.Currency)
 
 	// Валидация входных данных
 	if errs := ws.validator.ValidateAccount(&acc); len(errs) > 0 {
@@ -58,6 +90,18 @@ func (ws *WalletService) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	claim, cached, ok := ws.beginIdempotent(ctx, w, idempotencyEndpointCreateAccount, r, body)
+	if !ok {
+		return
+	}
+	if cached != nil {
+		writeCachedResponse(w, cached)
+		return
+	}
+	if claim != nil {
+		defer claim.Release()
+	}
+
 	tx, err := ws.db.BeginTx(ctx, nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error")
@@ -84,10 +128,10 @@ func (ws *WalletService) CreateAccount(w http.ResponseWriter, r *http.Request) {
 
 	// Создаем новый аккаунт
 	err = tx.QueryRowContext(ctx, `
-        INSERT INTO accounts (id, balance, currency, created_at)
-        VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+        INSERT INTO accounts (id, currency, created_at)
+        VALUES ($1, $2, CURRENT_TIMESTAMP)
         RETURNING created_at
-    `, acc.ID, acc.Balance, acc.Currency).Scan(&acc.CreatedAt)
+    `, acc.ID, acc.Currency).Scan(&acc.CreatedAt)
 
 	if err != nil {
 		log.Printf("Error creating account: %v", err)
@@ -95,15 +139,35 @@ func (ws *WalletService) CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	respBody, err := json.Marshal(acc)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if claim != nil {
+		if err := claim.Finish(ctx, tx, http.StatusCreated, respBody); err != nil {
+			log.Printf("Error recording idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record idempotency key")
+			return
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		log.Printf("Error committing transaction: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, acc)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(respBody)
 }
 
+// GetBalance returns an account's ledger balance (the sum of its settled
+// postings) and its available balance (the ledger balance less anything
+// earmarked by a pending Hold; see AuthorizeTransfer).
 func (ws *WalletService) GetBalance(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -118,10 +182,10 @@ func (ws *WalletService) GetBalance(w http.ResponseWriter, r *http.Request) {
 
 	var account Account
 	err := ws.db.QueryRowContext(ctx, `
-        SELECT id, balance, created_at 
-        FROM accounts 
+        SELECT id, currency, created_at
+        FROM accounts
         WHERE id = $1
-    `, id).Scan(&account.ID, &account.Balance, &account.CreatedAt)
+    `, id).Scan(&account.ID, &account.Currency, &account.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		respondWithError(w, http.StatusNotFound, "Account not found")
@@ -132,12 +196,67 @@ func (ws *WalletService) GetBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, account)
+	ledger, err := ws.getLedgerBalance(ctx, ws.db, id)
+	if err != nil {
+		log.Printf("Error getting balance: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	available, err := ws.availableBalance(ctx, ws.db, id)
+	if err != nil {
+		log.Printf("Error getting balance: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, BalanceResponse{
+		ID:        account.ID,
+		Currency:  account.Currency,
+		Available: available,
+		Ledger:    ledger,
+		CreatedAt: account.CreatedAt,
+	})
+}
+
+// Quote returns a short-lived locked exchange rate that a subsequent
+// cross-currency Transfer can redeem via its quote_id.
+func (ws *WalletService) Quote(w http.ResponseWriter, r *http.Request) {
+	var req FXQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if errs := ws.validator.ValidateFXQuoteRequest(&req); len(errs) > 0 {
+		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"errors": errs,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	quote, err := ws.fx.Quote(ctx, req)
+	if err != nil {
+		log.Printf("Error getting fx quote: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get FX quote")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, quote)
 }
 
 func (ws *WalletService) Transfer(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
 	var tx Transaction
-	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+	if err := json.Unmarshal(body, &tx); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
@@ -152,6 +271,18 @@ func (ws *WalletService) Transfer(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	claim, cached, ok := ws.beginIdempotent(ctx, w, idempotencyEndpointTransfer, r, body)
+	if !ok {
+		return
+	}
+	if cached != nil {
+		writeCachedResponse(w, cached)
+		return
+	}
+	if claim != nil {
+		defer claim.Release()
+	}
+
 	dbTx, err := ws.db.BeginTx(ctx, nil)
 	if err != nil {
 		log.Printf("Error beginning transaction: %v", err)
@@ -160,81 +291,220 @@ func (ws *WalletService) Transfer(w http.ResponseWriter, r *http.Request) {
 	}
 	defer dbTx.Rollback()
 
-	var fromAcc, toAcc Account
-	if tx.From < tx.To {
-		err = ws.lockAndGetAccount(ctx, dbTx, tx.From, &fromAcc)
-		if err == nil {
-			err = ws.lockAndGetAccount(ctx, dbTx, tx.To, &toAcc)
+	fromCurrency, toCurrency, err := ws.accountCurrencies(ctx, dbTx, tx.From, tx.To)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "One or both accounts not found")
+		} else {
+			log.Printf("Error looking up account currencies: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Database error")
 		}
-	} else {
-		err = ws.lockAndGetAccount(ctx, dbTx, tx.To, &toAcc)
-		if err == nil {
-			err = ws.lockAndGetAccount(ctx, dbTx, tx.From, &fromAcc)
+		return
+	}
+
+	postings := []PostingEntry{
+		{AccountID: tx.From, Amount: tx.Amount.Negate()},
+		{AccountID: tx.To, Amount: tx.Amount},
+	}
+	var fxImbalances map[Currency]Money
+
+	if fromCurrency != toCurrency {
+		if tx.QuoteID == "" {
+			respondWithError(w, http.StatusBadRequest, "quote_id is required for a cross-currency transfer")
+			return
+		}
+
+		quote, err := ws.fx.redeem(ctx, dbTx, tx.QuoteID, fromCurrency, toCurrency, tx.Amount, tx.MinDestinationAmount)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				respondWithError(w, http.StatusNotFound, "FX quote not found")
+			case errFXQuoteExpired:
+				respondWithError(w, http.StatusBadRequest, "FX quote has expired")
+			case errFXQuoteMismatch:
+				respondWithError(w, http.StatusBadRequest, "FX quote does not match this transfer")
+			case errFXQuoteAlreadyRedeemed:
+				respondWithError(w, http.StatusConflict, "FX quote has already been redeemed")
+			case errFXSlippage:
+				respondWithError(w, http.StatusBadRequest, "Executed destination amount is below min_destination_amount")
+			default:
+				log.Printf("Error redeeming fx quote: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Database error")
+			}
+			return
+		}
+
+		tx.Rate = quote.Rate
+		tx.DestinationAmount = quote.DestinationAmount
+		postings = []PostingEntry{
+			{AccountID: tx.From, Amount: tx.Amount.Negate()},
+			{AccountID: tx.To, Amount: quote.DestinationAmount},
+		}
+		// A cross-currency transfer's two legs debit one currency and
+		// credit a different one by design, with nothing booked against
+		// either currency's opposite leg; exempt exactly those amounts -
+		// already validated against the redeemed quote above - from the
+		// usual per-currency zero-sum check.
+		fxImbalances = map[Currency]Money{
+			fromCurrency: tx.Amount.Negate(),
+			toCurrency:   quote.DestinationAmount,
 		}
 	}
 
+	tx.ID, tx.CreatedAt, err = ws.recordEntry(ctx, dbTx, postings, tx.Memo, tx.Reference, tx.Metadata, 0, fxImbalances, 0)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		switch err {
+		case sql.ErrNoRows:
 			respondWithError(w, http.StatusNotFound, "One or both accounts not found")
-		} else {
-			log.Printf("Error locking accounts: %v", err)
-			respondWithError(w, http.StatusInternalServerError, "Database error")
+		case errInsufficientFunds:
+			respondWithError(w, http.StatusBadRequest, "Insufficient funds")
+		case errUnbalancedEntry:
+			respondWithError(w, http.StatusBadRequest, "Entry postings must sum to zero")
+		case errInvalidAmountScale:
+			respondWithError(w, http.StatusBadRequest, "Amount has more precision than its account's currency allows")
+		default:
+			log.Printf("Error recording transaction: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record transaction")
 		}
 		return
 	}
+	tx.Status = transactionStatusCompleted
 
-	if fromAcc.Balance < tx.Amount {
-		respondWithError(w, http.StatusBadRequest, "Insufficient funds")
+	respBody, err := json.Marshal(tx)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	_, err = dbTx.ExecContext(ctx, `
-        UPDATE accounts 
-        SET balance = balance - $1 
-        WHERE id = $2
-    `, tx.Amount, tx.From)
+	if claim != nil {
+		if err := claim.Finish(ctx, dbTx, http.StatusOK, respBody); err != nil {
+			log.Printf("Error recording idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record idempotency key")
+			return
+		}
+	}
 
+	if err = dbTx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// Transactions records a single balanced multi-leg accounting entry, for
+// operations such as fees, splits, or escrow that don't fit a plain
+// from/to transfer.
+func (ws *WalletService) Transactions(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error updating source account: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to update source account")
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var batch TransactionBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if errs := ws.validator.ValidateTransactionBatch(&batch); len(errs) > 0 {
+		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"errors": errs,
+		})
 		return
 	}
 
-	_, err = dbTx.ExecContext(ctx, `
-        UPDATE accounts 
-        SET balance = balance + $1 
-        WHERE id = $2
-    `, tx.Amount, tx.To)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	claim, cached, ok := ws.beginIdempotent(ctx, w, idempotencyEndpointTransactions, r, body)
+	if !ok {
+		return
+	}
+	if cached != nil {
+		writeCachedResponse(w, cached)
+		return
+	}
+	if claim != nil {
+		defer claim.Release()
+	}
 
+	dbTx, err := ws.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error updating destination account: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to update destination account")
+		log.Printf("Error beginning transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
+	defer dbTx.Rollback()
 
-	tx.Status = "completed"
-	err = dbTx.QueryRowContext(ctx, `
-        INSERT INTO transactions 
-        (from_account, to_account, amount, status, created_at)
-        VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
-        RETURNING id, created_at
-    `, tx.From, tx.To, tx.Amount, tx.Status).Scan(&tx.ID, &tx.CreatedAt)
+	entry := Entry{Postings: batch.Postings, Memo: batch.Memo, Metadata: batch.Metadata, Reference: batch.Reference}
+	entry.ID, entry.CreatedAt, err = ws.recordEntry(ctx, dbTx, batch.Postings, batch.Memo, batch.Reference, batch.Metadata, 0, nil, 0)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithError(w, http.StatusNotFound, "One or more accounts not found")
+		case errInsufficientFunds:
+			respondWithError(w, http.StatusBadRequest, "Insufficient funds")
+		case errUnbalancedEntry:
+			respondWithError(w, http.StatusBadRequest, "Entry postings must sum to zero")
+		case errInvalidAmountScale:
+			respondWithError(w, http.StatusBadRequest, "Amount has more precision than its account's currency allows")
+		default:
+			log.Printf("Error recording entry: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record transaction")
+		}
+		return
+	}
+	entry.Status = transactionStatusCompleted
 
+	respBody, err := json.Marshal(entry)
 	if err != nil {
-		log.Printf("Error recording transaction: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to record transaction")
+		log.Printf("Error marshaling response: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
+	if claim != nil {
+		if err := claim.Finish(ctx, dbTx, http.StatusOK, respBody); err != nil {
+			log.Printf("Error recording idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record idempotency key")
+			return
+		}
+	}
+
 	if err = dbTx.Commit(); err != nil {
 		log.Printf("Error committing transaction: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, tx)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// TransactionHistoryResponse is the response shape for
+// GetTransactionHistory. NextCursor is set whenever a page may not be the
+// last one, and can be passed back as the ?cursor= of the next request.
+type TransactionHistoryResponse struct {
+	Entries    []LedgerEntry `json:"entries"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
 
+// GetTransactionHistory lists postings against an account, newest first,
+// with optional filters and keyset pagination:
+//
+//   - memo: substring match against the transaction's memo
+//   - reference: exact match against the transaction's reference
+//   - metadata.<key>: exact match against metadata->><key>; repeatable
+//   - from, to: RFC3339 timestamps bounding t.created_at (inclusive)
+//   - limit: page size, defaults to cfg.App.TransactionHistoryLimit
+//   - cursor: opaque cursor returned as next_cursor by a previous page
 func (ws *WalletService) GetTransactionHistory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -263,13 +533,75 @@ func (ws *WalletService) GetTransactionHistory(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	rows, err := ws.db.QueryContext(ctx, `
-        SELECT id, from_account, to_account, amount, status, created_at
-        FROM transactions
-        WHERE from_account = $1 OR to_account = $1
-        ORDER BY created_at DESC
-        LIMIT 100
-    `, id)
+	query := r.URL.Query()
+
+	limit := ws.cfg.App.TransactionHistoryLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	conditions := []string{"p.account_id = $1"}
+	args := []interface{}{id}
+
+	if memo := query.Get("memo"); memo != "" {
+		args = append(args, "%"+memo+"%")
+		conditions = append(conditions, fmt.Sprintf("t.memo ILIKE $%d", len(args)))
+	}
+	if reference := query.Get("reference"); reference != "" {
+		args = append(args, reference)
+		conditions = append(conditions, fmt.Sprintf("t.reference = $%d", len(args)))
+	}
+	const metadataParamPrefix = "metadata."
+	for key, values := range query {
+		if !strings.HasPrefix(key, metadataParamPrefix) || len(values) == 0 {
+			continue
+		}
+		metaKey := strings.TrimPrefix(key, metadataParamPrefix)
+		args = append(args, metaKey, values[0])
+		conditions = append(conditions, fmt.Sprintf("t.metadata ->> $%d = $%d", len(args)-1, len(args)))
+	}
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid from: expected RFC3339 timestamp")
+			return
+		}
+		args = append(args, parsed)
+		conditions = append(conditions, fmt.Sprintf("t.created_at >= $%d", len(args)))
+	}
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid to: expected RFC3339 timestamp")
+			return
+		}
+		args = append(args, parsed)
+		conditions = append(conditions, fmt.Sprintf("t.created_at <= $%d", len(args)))
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		cursorCreatedAt, cursorID, err := decodeCursor(cursor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		args = append(args, cursorCreatedAt, cursorID)
+		conditions = append(conditions, fmt.Sprintf("(t.created_at, t.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	args = append(args, limit)
+	rows, err := ws.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT t.id, p.account_id, p.amount, t.status, t.memo, t.metadata, t.reference, t.created_at
+        FROM postings p
+        JOIN transactions t ON t.id = p.transaction_id
+        WHERE %s
+        ORDER BY t.created_at DESC, t.id DESC
+        LIMIT $%d
+    `, strings.Join(conditions, " AND "), len(args)), args...)
 
 	if err != nil {
 		log.Printf("Error getting transaction history: %v", err)
@@ -278,23 +610,28 @@ func (ws *WalletService) GetTransactionHistory(w http.ResponseWriter, r *http.Re
 	}
 	defer rows.Close()
 
-	var transactions []Transaction
+	var entries []LedgerEntry
 	for rows.Next() {
-		var tx Transaction
+		var entry LedgerEntry
+		var memo, reference sql.NullString
 		err := rows.Scan(
-			&tx.ID,
-			&tx.From,
-			&tx.To,
-			&tx.Amount,
-			&tx.Status,
-			&tx.CreatedAt,
+			&entry.TransactionID,
+			&entry.AccountID,
+			&entry.Amount,
+			&entry.Status,
+			&memo,
+			&entry.Metadata,
+			&reference,
+			&entry.CreatedAt,
 		)
 		if err != nil {
 			log.Printf("Error scanning transaction: %v", err)
 			respondWithError(w, http.StatusInternalServerError, "Database error")
 			return
 		}
-		transactions = append(transactions, tx)
+		entry.Memo = memo.String
+		entry.Reference = reference.String
+		entries = append(entries, entry)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -303,16 +640,368 @@ func (ws *WalletService) GetTransactionHistory(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, transactions)
+	resp := TransactionHistoryResponse{Entries: entries}
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.TransactionID)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// AuthorizeTransfer places a hold against From, reserving amount out of its
+// available balance without moving anything in the ledger. The hold is
+// released back to From's available balance by VoidTransfer, or settled as
+// a real transaction by CaptureTransfer.
+func (ws *WalletService) AuthorizeTransfer(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var hold Hold
+	if err := json.Unmarshal(body, &hold); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if errs := ws.validator.ValidateHold(&hold); len(errs) > 0 {
+		respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"errors": errs,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	claim, cached, ok := ws.beginIdempotent(ctx, w, idempotencyEndpointAuthorize, r, body)
+	if !ok {
+		return
+	}
+	if cached != nil {
+		writeCachedResponse(w, cached)
+		return
+	}
+	if claim != nil {
+		defer claim.Release()
+	}
+
+	dbTx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer dbTx.Rollback()
+
+	result, err := ws.authorizeHold(ctx, dbTx, hold.From, hold.To, hold.Amount)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithError(w, http.StatusNotFound, "One or both accounts not found")
+		case errInsufficientAvailable:
+			respondWithError(w, http.StatusBadRequest, "Insufficient available funds")
+		case errInvalidAmountScale:
+			respondWithError(w, http.StatusBadRequest, "Amount has more precision than its account's currency allows")
+		default:
+			log.Printf("Error authorizing hold: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to authorize hold")
+		}
+		return
+	}
+
+	respBody, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if claim != nil {
+		if err := claim.Finish(ctx, dbTx, http.StatusCreated, respBody); err != nil {
+			log.Printf("Error recording idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record idempotency key")
+			return
+		}
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(respBody)
 }
 
-func (ws *WalletService) lockAndGetAccount(ctx context.Context, tx *sql.Tx, id string, acc *Account) error {
-	return tx.QueryRowContext(ctx, `
-        SELECT id, balance, created_at 
-        FROM accounts 
-        WHERE id = $1 
-        FOR UPDATE
-    `, id).Scan(&acc.ID, &acc.Balance, &acc.CreatedAt)
+// CaptureTransfer settles a pending hold as a real ledger transaction, in
+// full or (via an optional request body amount) in part.
+func (ws *WalletService) CaptureTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	holdID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid hold ID")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var amount *Money
+	if len(strings.TrimSpace(string(body))) > 0 {
+		var req CaptureRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if errs := ws.validator.ValidateCaptureRequest(&req); len(errs) > 0 {
+			respondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		if !req.Amount.IsZero() {
+			amount = &req.Amount
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// The hold id is part of the URL, not the body, so it's folded into the
+	// idempotency hash explicitly: otherwise two different holds captured
+	// with an empty body and the same Idempotency-Key would be
+	// indistinguishable.
+	claim, cached, ok := ws.beginIdempotent(ctx, w, idempotencyEndpointCapture, r, append([]byte(vars["id"]+":"), body...))
+	if !ok {
+		return
+	}
+	if cached != nil {
+		writeCachedResponse(w, cached)
+		return
+	}
+	if claim != nil {
+		defer claim.Release()
+	}
+
+	dbTx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer dbTx.Rollback()
+
+	entry, err := ws.captureHold(ctx, dbTx, holdID, amount)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithError(w, http.StatusNotFound, "Hold not found")
+		case errHoldNotPending:
+			respondWithError(w, http.StatusConflict, "Hold is not pending")
+		case errCaptureExceedsHold:
+			respondWithError(w, http.StatusBadRequest, "Capture amount exceeds the held amount")
+		case errInvalidAmountScale:
+			respondWithError(w, http.StatusBadRequest, "Amount has more precision than its account's currency allows")
+		default:
+			log.Printf("Error capturing hold: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to capture hold")
+		}
+		return
+	}
+
+	respBody, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if claim != nil {
+		if err := claim.Finish(ctx, dbTx, http.StatusOK, respBody); err != nil {
+			log.Printf("Error recording idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record idempotency key")
+			return
+		}
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// VoidTransfer releases a pending hold without moving any funds. Voiding is
+// naturally idempotent - voiding an already-voided hold is simply an error
+// a retry can ignore - so, unlike capture, it doesn't go through the
+// Idempotency-Key machinery.
+func (ws *WalletService) VoidTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	holdID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid hold ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	dbTx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer dbTx.Rollback()
+
+	hold, err := ws.voidHold(ctx, dbTx, holdID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithError(w, http.StatusNotFound, "Hold not found")
+		case errHoldNotPending:
+			respondWithError(w, http.StatusConflict, "Hold is not pending")
+		default:
+			log.Printf("Error voiding hold: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to void hold")
+		}
+		return
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, hold)
+}
+
+// ReverseTransfer creates a compensating entry for a completed, two-leg
+// transaction, linked back to it via reverses_transaction_id, and marks the
+// original reversed.
+func (ws *WalletService) ReverseTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	transactionID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// As with capture, the transaction id lives in the URL, so it's folded
+	// into the idempotency hash to disambiguate reversals of different
+	// transactions sharing an Idempotency-Key.
+	claim, cached, ok := ws.beginIdempotent(ctx, w, idempotencyEndpointReverse, r, []byte(vars["id"]))
+	if !ok {
+		return
+	}
+	if cached != nil {
+		writeCachedResponse(w, cached)
+		return
+	}
+	if claim != nil {
+		defer claim.Release()
+	}
+
+	dbTx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer dbTx.Rollback()
+
+	entry, err := ws.reverseTransaction(ctx, dbTx, transactionID)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			respondWithError(w, http.StatusNotFound, "Transaction not found")
+		case errAlreadyReversed:
+			respondWithError(w, http.StatusConflict, "Transaction has already been reversed")
+		case errNotReversible:
+			respondWithError(w, http.StatusBadRequest, "Transaction is not a reversible two-leg transfer")
+		case errInsufficientFunds:
+			respondWithError(w, http.StatusBadRequest, "Insufficient funds")
+		case errUnbalancedEntry:
+			respondWithError(w, http.StatusBadRequest, "Transaction cannot be reversed")
+		default:
+			log.Printf("Error reversing transaction: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+		}
+		return
+	}
+
+	respBody, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if claim != nil {
+		if err := claim.Finish(ctx, dbTx, http.StatusOK, respBody); err != nil {
+			log.Printf("Error recording idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to record idempotency key")
+			return
+		}
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transaction")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody)
+}
+
+// beginIdempotent claims the Idempotency-Key header on r, if present. ok is
+// false if a response has already been written and the caller should
+// return immediately. cached is non-nil if a previous request already
+// completed and its response should be replayed as-is. claim is non-nil if
+// the caller won the race to handle this key and must call claim.Finish
+// before committing its own DB transaction and claim.Release afterwards.
+func (ws *WalletService) beginIdempotent(ctx context.Context, w http.ResponseWriter, endpoint string, r *http.Request, body []byte) (claim *Claim, cached *CachedResponse, ok bool) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		return nil, nil, true
+	}
+
+	cached, claim, err := ws.idempotency.Begin(ctx, endpoint, key, HashBody(body))
+	if err != nil {
+		if err == ErrIdempotencyKeyMismatch {
+			respondWithError(w, http.StatusConflict, "Idempotency-Key already used with a different request body")
+		} else {
+			log.Printf("Error claiming idempotency key: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+		}
+		return nil, nil, false
+	}
+
+	return claim, cached, true
+}
+
+func writeCachedResponse(w http.ResponseWriter, cached *CachedResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(cached.StatusCode)
+	w.Write(cached.Body)
 }
 
 func respondWithError(w http.ResponseWriter, code int, message string) {